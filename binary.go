@@ -0,0 +1,132 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// binaryMagic identifies the wire format MarshalBinary produces: magic,
+// version, precision, flags, a 4-byte payload length, then the payload.
+var binaryMagic = [3]byte{'H', 'L', 'L'}
+
+const binaryVersion = 1
+
+const binaryHeaderLen = len(binaryMagic) + 1 + 1 + 1 + 4
+
+// Flag bits describing how the payload following the header is encoded.
+const (
+	binaryFlagSparse  = 1 << 0 // varint-delta encoded sparse list
+	binaryFlagPacked6 = 1 << 1 // dense registers, 6 bits each
+	binaryFlagRaw8    = 1 << 2 // dense registers, 1 byte each
+)
+
+// MarshalBinary encodes h into a compact, self-describing wire format
+// suitable for cross-language interop (e.g. with Java/Redis HLLs): magic
+// "HLL", a version byte, the precision, a flags byte, a 4-byte payload
+// length, then the payload itself. Dense sketches at p<=12 are packed 6
+// bits per register, since a register value never exceeds 63 for a 64-bit
+// hash (33 for a 32-bit one); sparse sketches emit a varint count of their
+// unmerged tmp entries, those entries as varints, then their varint-delta
+// stream as-is.
+func (h *HyperLogLog) MarshalBinary() ([]byte, error) {
+	var flags byte
+	var payload []byte
+
+	switch {
+	case h.sparse:
+		flags = binaryFlagSparse
+		payload = encodeSparsePayload(h.tmpSet, h.sparseList)
+	case h.p <= 12:
+		flags = binaryFlagPacked6
+		payload = pack6(h.reg)
+	default:
+		flags = binaryFlagRaw8
+		payload = h.reg
+	}
+
+	buf := make([]byte, 0, binaryHeaderLen+len(payload))
+	buf = append(buf, binaryMagic[:]...)
+	buf = append(buf, binaryVersion, h.p, flags)
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(payload)))
+	buf = append(buf, lenBuf[:]...)
+	buf = append(buf, payload...)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a payload produced by MarshalBinary.
+func (h *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < binaryHeaderLen || !bytes.Equal(data[:len(binaryMagic)], binaryMagic[:]) {
+		return errors.New("hyperloglog: not a HLL binary payload")
+	}
+	i := len(binaryMagic)
+	version := data[i]
+	if version != binaryVersion {
+		return fmt.Errorf("hyperloglog: unsupported binary version %d", version)
+	}
+	p := data[i+1]
+	flags := data[i+2]
+	n := binary.BigEndian.Uint32(data[i+3 : i+7])
+	payload := data[i+7:]
+	if uint64(len(payload)) < uint64(n) {
+		return errors.New("hyperloglog: truncated binary payload")
+	}
+	payload = payload[:n]
+
+	switch {
+	case flags&binaryFlagSparse != 0:
+		tmpSet, sparseList, err := decodeSparsePayload(payload)
+		if err != nil {
+			return err
+		}
+		*h = HyperLogLog{p: p, m: 1 << p, sparse: true, tmpSet: tmpSet, sparseList: sparseList, hash: defaultHash64}
+	case flags&binaryFlagPacked6 != 0:
+		*h = HyperLogLog{p: p, m: 1 << p, reg: unpack6(payload, 1<<p), hash: defaultHash64}
+	case flags&binaryFlagRaw8 != 0:
+		*h = HyperLogLog{p: p, m: 1 << p, reg: append([]byte(nil), payload...), hash: defaultHash64}
+	default:
+		return errors.New("hyperloglog: unknown binary flags")
+	}
+	return nil
+}
+
+// pack6 packs reg, 6 bits per register, LSB first.
+func pack6(reg []uint8) []byte {
+	out := make([]byte, 0, (len(reg)*6+7)/8)
+	var acc uint32
+	var bits uint
+	for _, v := range reg {
+		acc |= uint32(v&0x3f) << bits
+		bits += 6
+		for bits >= 8 {
+			out = append(out, byte(acc))
+			acc >>= 8
+			bits -= 8
+		}
+	}
+	if bits > 0 {
+		out = append(out, byte(acc))
+	}
+	return out
+}
+
+// unpack6 reverses pack6 into m registers.
+func unpack6(b []byte, m uint32) []uint8 {
+	reg := make([]uint8, m)
+	var acc uint32
+	var bits uint
+	bi := 0
+	for i := uint32(0); i < m; i++ {
+		for bits < 6 && bi < len(b) {
+			acc |= uint32(b[bi]) << bits
+			bits += 8
+			bi++
+		}
+		reg[i] = uint8(acc & 0x3f)
+		acc >>= 6
+		bits -= 6
+	}
+	return reg
+}
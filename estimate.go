@@ -0,0 +1,70 @@
+package hyperloglog
+
+import "sort"
+
+// biasNeighbors is the number of nearest neighbors averaged together by
+// estimateBias, following the HLL++ paper's choice of k=6.
+const biasNeighbors = 6
+
+// threshold returns the raw-estimate cutover below which Count should use
+// linear counting instead of the (bias-corrected) raw estimate, for
+// precision p.
+func threshold(p uint8) float64 {
+	if int(p) < minBiasP || int(p) > maxBiasP {
+		return 0
+	}
+	return thresholdData[int(p)-minBiasP]
+}
+
+// estimateBias looks up the k nearest neighbors of the raw estimate e in
+// rawEstimateData[p] and returns the average of their corresponding
+// biasData[p] entries. Count subtracts the result from the raw estimate.
+func estimateBias(p uint8, e float64) float64 {
+	if int(p) < minBiasP || int(p) > maxBiasP {
+		return 0
+	}
+	raw := rawEstimateData[int(p)-minBiasP]
+	bias := biasData[int(p)-minBiasP]
+
+	k := biasNeighbors
+	if k > len(raw) {
+		k = len(raw)
+	}
+	if k == 0 {
+		return 0
+	}
+
+	// The k nearest samples to e all lie within k places of e's insertion
+	// point in raw, so only raw[lo:hi) is ranked by distance below.
+	i := sort.SearchFloat64s(raw, e)
+	lo, hi := i-k, i+k
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > len(raw) {
+		hi = len(raw)
+	}
+
+	type neighbor struct {
+		dist float64
+		idx  int
+	}
+	candidates := make([]neighbor, 0, hi-lo)
+	for j := lo; j < hi; j++ {
+		d := raw[j] - e
+		if d < 0 {
+			d = -d
+		}
+		candidates = append(candidates, neighbor{dist: d, idx: j})
+	}
+	sort.Slice(candidates, func(a, b int) bool { return candidates[a].dist < candidates[b].dist })
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+
+	var sum float64
+	for _, c := range candidates {
+		sum += bias[c.idx]
+	}
+	return sum / float64(len(candidates))
+}
@@ -16,19 +16,61 @@ import (
 	"encoding/base64"
 	"encoding/gob"
 	"errors"
+	"hash/fnv"
 	"math"
 )
 
 const two32 = 1 << 32
 
+// HyperLogLog is backed by a dense register array once it has seen enough
+// distinct items, but starts out in a sparse representation: a sorted,
+// delta+varint encoded list of (index, count) entries (sparseList) plus a
+// small unsorted buffer of entries awaiting a merge (tmpSet). The sparse
+// form is promoted to the dense reg array once its encoded size stops
+// paying for itself; see sparse.go.
 type HyperLogLog struct {
 	reg []uint8
 	m   uint32
 	p   uint8
+
+	sparse     bool
+	tmpSet     []uint32
+	sparseList []byte
+
+	hash func([]byte) uint64
+}
+
+// defaultHash64 is the hasher New and NewReg wire up AddBytes with. FNV-1a's
+// raw sum doesn't avalanche well in its high bits, which is exactly where
+// add's dense register index is taken from, so the sum is run through the
+// SplitMix64 finalizer before being returned.
+func defaultHash64(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return mix64(h.Sum64())
+}
+
+// mix64 is the SplitMix64 finalizer: a cheap, well-studied bit avalanche
+// that makes it safe to take the top bits of, or truncate, its output.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
 }
 
 // New returns a new initialized HyperLogLog.
 func New(precision uint8) (*HyperLogLog, error) {
+	return NewWithHasher(precision, defaultHash64)
+}
+
+// NewWithHasher returns a new initialized HyperLogLog whose AddBytes method
+// hashes with the supplied function instead of the default FNV-1a, so
+// callers can plug in xxhash, metrohash, murmur3, etc. without wrapping it
+// in a hash.Hash64.
+func NewWithHasher(precision uint8, hash func([]byte) uint64) (*HyperLogLog, error) {
 	if precision > 16 || precision < 4 {
 		return nil, errors.New("precision must be between 4 and 16")
 	}
@@ -36,7 +78,8 @@ func New(precision uint8) (*HyperLogLog, error) {
 	h := &HyperLogLog{}
 	h.p = precision
 	h.m = 1 << precision
-	h.reg = make([]uint8, h.m)
+	h.sparse = true
+	h.hash = hash
 	return h, nil
 }
 
@@ -53,39 +96,75 @@ func NewReg(reg []uint8) (*HyperLogLog, error) {
 	}
 
 	h := &HyperLogLog{
-		p:   uint8(p),
-		m:   uint32(m),
-		reg: reg,
+		p:    uint8(p),
+		m:    uint32(m),
+		reg:  reg,
+		hash: defaultHash64,
 	}
 
 	return h, nil
 }
 
-// Registers returns raw registers of HyperLogLog.
+// Registers returns raw registers of HyperLogLog. If h is still in its
+// sparse representation it is promoted to dense first.
 func (h *HyperLogLog) Registers() []uint8 {
+	if h.sparse {
+		h.densify()
+	}
 	return h.reg
 }
 
 // Copy returns copy of HyperLogLog.
 func (h *HyperLogLog) Copy() *HyperLogLog {
-	reg := make([]byte, len(h.reg))
-	copy(reg, h.reg)
-	h, err := NewReg(reg)
-	if err != nil {
-		// should never happen assuming h is correct
-		panic(err)
+	c := &HyperLogLog{p: h.p, m: h.m, sparse: h.sparse, hash: h.hash}
+	if h.sparse {
+		c.tmpSet = append([]uint32(nil), h.tmpSet...)
+		c.sparseList = append([]byte(nil), h.sparseList...)
+		return c
 	}
-	return h
+	c.reg = append([]uint8(nil), h.reg...)
+	return c
 }
 
 // Clear sets HyperLogLog h back to its initial state.
 func (h *HyperLogLog) Clear() {
-	h.reg = make([]uint8, h.m)
+	h.sparse = true
+	h.reg = nil
+	h.tmpSet = nil
+	h.sparseList = nil
 }
 
 // Add adds a new item to HyperLogLog h.
 func (h *HyperLogLog) Add(item Hash32) {
-	x := item.Sum32()
+	h.add(item.Sum32())
+}
+
+// Add64 adds a new item to HyperLogLog h using a 64-bit hash, so callers
+// already holding one (e.g. from xxhash or murmur3) don't need to wrap it
+// in a hash.Hash32. Since precision tops out at 16, only the low 32 bits
+// of the hash are used -- including in the sparse representation, whose
+// p'=25 index is itself derived from a 32-bit word (see encodeHash in
+// sparse.go), so a 64-bit hash doesn't currently buy it any extra
+// resolution there either.
+func (h *HyperLogLog) Add64(item Hash64) {
+	h.add(uint32(item.Sum64()))
+}
+
+// AddBytes hashes b with h's configured hash function (FNV-1a by default,
+// or whatever was passed to NewWithHasher) and adds it to h. It avoids the
+// per-item hash.Hash32/Hash64 allocation that Add and Add64 push onto
+// their callers. Like Add64, only the low 32 bits of the hash reach add,
+// dense or sparse.
+func (h *HyperLogLog) AddBytes(b []byte) {
+	h.add(uint32(h.hash(b)))
+}
+
+func (h *HyperLogLog) add(x uint32) {
+	if h.sparse {
+		h.addSparse(x)
+		return
+	}
+
 	i := eb32(x, 32, 32-h.p) // {x31,...,x32-p}
 	w := x<<h.p | 1<<(h.p-1) // {x32-p,...,x0}
 
@@ -101,9 +180,29 @@ func (h *HyperLogLog) Merge(other *HyperLogLog) error {
 		return errors.New("precisions must be equal")
 	}
 
-	for i, v := range other.reg {
-		if v > h.reg[i] {
-			h.reg[i] = v
+	switch {
+	case h.sparse && other.sparse:
+		h.tmpSet = append(h.tmpSet, other.sparseEntries()...)
+		h.mergeSparse()
+	case h.sparse && !other.sparse:
+		h.densify()
+		for i, v := range other.reg {
+			if v > h.reg[i] {
+				h.reg[i] = v
+			}
+		}
+	case !h.sparse && other.sparse:
+		for _, e := range other.sparseEntries() {
+			idx, count := projectEntry(e, h.p)
+			if count > h.reg[idx] {
+				h.reg[idx] = count
+			}
+		}
+	default:
+		for i, v := range other.reg {
+			if v > h.reg[i] {
+				h.reg[i] = v
+			}
 		}
 	}
 	return nil
@@ -111,67 +210,182 @@ func (h *HyperLogLog) Merge(other *HyperLogLog) error {
 
 // Count returns the cardinality estimate.
 func (h *HyperLogLog) Count() uint64 {
+	if h.sparse {
+		h.mergeSparse()
+		mPrime := uint32(1) << sparsePrecision
+		zeros := mPrime - uint32(len(decodeSparseList(h.sparseList)))
+		return uint64(linearCounting(mPrime, zeros))
+	}
+
 	est := calculateEstimate(h.reg)
-	if est <= float64(h.m)*2.5 {
-		if v := countZeros(h.reg); v != 0 {
-			return uint64(linearCounting(h.m, v))
+	if est <= 5*float64(h.m) {
+		corrected := est - estimateBias(h.p, est)
+		if corrected < 0 {
+			corrected = 0
 		}
-		return uint64(est)
+		if corrected <= threshold(h.p) {
+			if v := countZeros(h.reg); v != 0 {
+				return uint64(linearCounting(h.m, v))
+			}
+		}
+		return uint64(corrected)
 	} else if est < two32/30 {
 		return uint64(est)
 	}
 	return uint64(-two32 * math.Log(1-est/two32))
 }
 
-// Encode HyperLogLog into a gob
+// Format tags that an earlier version of GobEncode and MarshalText wrote as
+// the first byte of the gob stream and the (decoded) text payload to tell a
+// dense encoding from a sparse one. Today's encoders wrap MarshalBinary
+// instead; GobDecode and UnmarshalText still read the tagged layouts.
+const (
+	formatDense  = 0
+	formatSparse = 1
+)
+
+// Encode HyperLogLog into a gob, by wrapping the compact representation
+// MarshalBinary produces in a single gob field.
 func (h *HyperLogLog) GobEncode() ([]byte, error) {
-	buf := bytes.Buffer{}
-	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(h.reg); err != nil {
-		return nil, err
-	}
-	if err := enc.Encode(h.m); err != nil {
+	bin, err := h.MarshalBinary()
+	if err != nil {
 		return nil, err
 	}
-	if err := enc.Encode(h.p); err != nil {
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(bin); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-// Decode gob into a HyperLogLog structure
+// Decode gob into a HyperLogLog structure. Tries, in order: the untagged
+// reg-first layout the very first version of GobEncode used, today's
+// single-field MarshalBinary wrapper, and finally the
+// formatDense/formatSparse-tagged layout the sparse representation
+// introduced -- so blobs written by any released version of this package
+// still decode.
 func (h *HyperLogLog) GobDecode(b []byte) error {
+	if h.hash == nil {
+		h.hash = defaultHash64
+	}
+
+	if reg, m, p, err := gobDecodeLegacy(b); err == nil {
+		h.sparse = false
+		h.reg, h.m, h.p = reg, m, p
+		return nil
+	}
+
+	if bin, err := gobDecodeSingleField(b); err == nil && bytes.HasPrefix(bin, binaryMagic[:]) {
+		return h.UnmarshalBinary(bin)
+	}
+
 	dec := gob.NewDecoder(bytes.NewBuffer(b))
-	if err := dec.Decode(&h.reg); err != nil {
+	var tag uint8
+	if err := dec.Decode(&tag); err != nil {
 		return err
 	}
+	switch tag {
+	case formatSparse:
+		h.sparse = true
+		if err := dec.Decode(&h.tmpSet); err != nil {
+			return err
+		}
+		if err := dec.Decode(&h.sparseList); err != nil {
+			return err
+		}
+	case formatDense:
+		h.sparse = false
+		if err := dec.Decode(&h.reg); err != nil {
+			return err
+		}
+	default:
+		return errors.New("hyperloglog: unknown gob format tag")
+	}
 	if err := dec.Decode(&h.m); err != nil {
 		return err
 	}
-	if err := dec.Decode(&h.p); err != nil {
-		return err
+	return dec.Decode(&h.p)
+}
+
+func gobDecodeLegacy(b []byte) (reg []uint8, m uint32, p uint8, err error) {
+	dec := gob.NewDecoder(bytes.NewBuffer(b))
+	if err = dec.Decode(&reg); err != nil {
+		return nil, 0, 0, err
 	}
-	return nil
+	if err = dec.Decode(&m); err != nil {
+		return nil, 0, 0, err
+	}
+	if err = dec.Decode(&p); err != nil {
+		return nil, 0, 0, err
+	}
+	return reg, m, p, nil
 }
 
-// MarshalText marshals HLL into text data (registers as base64)
+func gobDecodeSingleField(b []byte) ([]byte, error) {
+	var bin []byte
+	if err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&bin); err != nil {
+		return nil, err
+	}
+	return bin, nil
+}
+
+// MarshalText marshals HLL into text data: MarshalBinary's compact
+// representation, base64-encoded.
 func (h *HyperLogLog) MarshalText() ([]byte, error) {
-	dst := make([]byte, base64.StdEncoding.EncodedLen(len(h.reg)))
-	base64.StdEncoding.Encode(dst, h.reg)
+	bin, err := h.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	dst := make([]byte, base64.StdEncoding.EncodedLen(len(bin)))
+	base64.StdEncoding.Encode(dst, bin)
 	return dst, nil
 }
 
-// UnmarshalText unmarshals HLL from text data prod by MarshalText
+// UnmarshalText unmarshals HLL from text data produced by MarshalText, or
+// from the formatDense/formatSparse-tagged or plain base64(registers) text
+// that earlier versions of this package produced.
 func (h *HyperLogLog) UnmarshalText(text []byte) error {
-	reg := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
-	n, err := base64.StdEncoding.Decode(reg, text)
+	raw := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+	n, err := base64.StdEncoding.Decode(raw, text)
 	if err != nil {
 		return err
 	}
-	h2, err := NewReg(reg[:n])
-	if err != nil {
-		return err
+	raw = raw[:n]
+
+	if bytes.HasPrefix(raw, binaryMagic[:]) {
+		return h.UnmarshalBinary(raw)
+	}
+
+	// A legacy payload is bare registers; try that interpretation next
+	// since a tagged payload will essentially never also be a valid
+	// power-of-two register array.
+	if h2, err := NewReg(append([]byte(nil), raw...)); err == nil {
+		*h = *h2
+		return nil
+	}
+
+	if len(raw) == 0 {
+		return errors.New("hyperloglog: empty payload")
+	}
+	switch raw[0] {
+	case formatDense:
+		h2, err := NewReg(raw[1:])
+		if err != nil {
+			return err
+		}
+		*h = *h2
+	case formatSparse:
+		if len(raw) < 2 {
+			return errors.New("hyperloglog: truncated sparse payload")
+		}
+		p := raw[1]
+		tmpSet, sparseList, err := decodeSparsePayload(raw[2:])
+		if err != nil {
+			return err
+		}
+		*h = HyperLogLog{p: p, m: 1 << p, sparse: true, tmpSet: tmpSet, sparseList: sparseList, hash: defaultHash64}
+	default:
+		return errors.New("hyperloglog: unknown text format tag")
 	}
-	*h = *h2
 	return nil
 }
@@ -0,0 +1,137 @@
+package hyperloglog
+
+import (
+	"errors"
+	"sort"
+)
+
+// registersSnapshot returns h's registers as a dense array without
+// mutating h, densifying a sparse representation into a throwaway buffer
+// if needed. Callers that already hold h.reg are free to treat the result
+// as read-only.
+func (h *HyperLogLog) registersSnapshot() []uint8 {
+	if !h.sparse {
+		return h.reg
+	}
+	reg := make([]uint8, h.m)
+	for _, e := range h.sparseEntries() {
+		idx, count := projectEntry(e, h.p)
+		if count > reg[idx] {
+			reg[idx] = count
+		}
+	}
+	return reg
+}
+
+// mergeRegistersInto writes the element-wise maximum of dst and src into
+// dst, 8 registers at a time so the bounds check and comparison in the
+// inner loop can be hoisted/vectorized by the compiler.
+func mergeRegistersInto(dst, src []uint8) {
+	i := 0
+	for ; i+8 <= len(dst); i += 8 {
+		d := dst[i : i+8 : i+8]
+		s := src[i : i+8 : i+8]
+		for j := 0; j < 8; j++ {
+			if s[j] > d[j] {
+				d[j] = s[j]
+			}
+		}
+	}
+	for ; i < len(dst); i++ {
+		if src[i] > dst[i] {
+			dst[i] = src[i]
+		}
+	}
+}
+
+// MergeMany returns a new HyperLogLog combining sketches. Unlike Merge, it
+// mutates none of its arguments. All sketches must share the same
+// precision.
+//
+// If every sketch is still sparse, the result is built by merging their
+// p'=25-resolution entries directly, so the union keeps the sparse
+// representation's extra precision instead of being forced down to
+// whichever dense register each item would have landed in at p. Otherwise
+// the result falls back to the register-wise maximum across sketches,
+// computed in a single pass, 8 registers at a time.
+func MergeMany(sketches ...*HyperLogLog) (*HyperLogLog, error) {
+	if len(sketches) == 0 {
+		return nil, errors.New("hyperloglog: MergeMany requires at least one sketch")
+	}
+
+	p, m, hash := sketches[0].p, sketches[0].m, sketches[0].hash
+	allSparse := true
+	for _, s := range sketches {
+		if s.p != p {
+			return nil, errors.New("precisions must be equal")
+		}
+		if !s.sparse {
+			allSparse = false
+		}
+	}
+
+	if allSparse {
+		var entries []uint32
+		for _, s := range sketches {
+			entries = append(entries, s.sparseEntries()...)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i] < entries[j] })
+		entries = dedupeEntries(entries)
+
+		result := &HyperLogLog{p: p, m: m, sparse: true, sparseList: encodeSparseList(entries), hash: hash}
+		if uint32(len(result.sparseList)) >= m {
+			result.densify()
+		}
+		return result, nil
+	}
+
+	reg := make([]uint8, m)
+	for _, s := range sketches {
+		mergeRegistersInto(reg, s.registersSnapshot())
+	}
+
+	return &HyperLogLog{p: p, m: m, reg: reg, hash: hash}, nil
+}
+
+// Union returns a new HyperLogLog estimating the cardinality of the union
+// of h and others, without mutating h or any of others. Compare Merge,
+// which folds other into h in place.
+func (h *HyperLogLog) Union(others ...*HyperLogLog) (*HyperLogLog, error) {
+	return MergeMany(append([]*HyperLogLog{h}, others...)...)
+}
+
+// Intersect estimates the cardinality of the intersection of h and other
+// via inclusion-exclusion: |A∩B| = |A| + |B| - |A∪B|. Like Union, it does
+// not mutate either receiver. Estimation error can push the raw result
+// below zero for near-disjoint sketches; that case is clamped to 0.
+func (h *HyperLogLog) Intersect(other *HyperLogLog) (uint64, error) {
+	union, err := h.Union(other)
+	if err != nil {
+		return 0, err
+	}
+
+	sum := int64(h.Count()) + int64(other.Count())
+	inter := sum - int64(union.Count())
+	if inter < 0 {
+		return 0, nil
+	}
+	return uint64(inter), nil
+}
+
+// Jaccard estimates the Jaccard index |A∩B|/|A∪B| between h and other.
+func (h *HyperLogLog) Jaccard(other *HyperLogLog) (float64, error) {
+	union, err := h.Union(other)
+	if err != nil {
+		return 0, err
+	}
+	unionCount := union.Count()
+	if unionCount == 0 {
+		return 0, nil
+	}
+
+	inter, err := h.Intersect(other)
+	if err != nil {
+		return 0, err
+	}
+	return float64(inter) / float64(unionCount), nil
+}
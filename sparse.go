@@ -0,0 +1,209 @@
+package hyperloglog
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// sparsePrecision is the precision p' used by the sparse representation.
+// Sparse entries index registers at a higher resolution than the dense
+// array they may eventually be promoted to, which lets a sketch be
+// downgraded to any supported p without losing accuracy in the process.
+const sparsePrecision = 25
+
+// encodeHash packs a 32-bit hash into a single sparse entry: the top
+// sparsePrecision bits hold the register index at p' resolution and the
+// low 7 bits hold the number of leading zeros (plus one) seen in the
+// remaining bits. Sorting entries numerically therefore sorts them by
+// index first, which is what makes the delta+varint encoding effective.
+func encodeHash(x uint32) uint32 {
+	idx := eb32(x, 32, 32-sparsePrecision)
+	w := x<<sparsePrecision | 1<<(sparsePrecision-1)
+	zeros := uint32(clz32(w)) + 1
+	return idx<<7 | zeros
+}
+
+func sparseIndex(e uint32) uint32 { return e >> 7 }
+func sparseCount(e uint32) uint8  { return uint8(e & 0x7f) }
+
+// projectEntry downgrades a sparse entry encoded at sparsePrecision down
+// to a register index and count at precision p, p <= sparsePrecision.
+func projectEntry(e uint32, p uint8) (idx uint32, count uint8) {
+	full := sparseIndex(e)
+	extraBits := sparsePrecision - p
+	idx = full >> extraBits
+	extra := full & uint32((1<<extraBits)-1)
+	if extra == 0 {
+		count = sparseCount(e) + extraBits
+		return
+	}
+	count = clz32(extra<<(32-extraBits)) + 1
+	return
+}
+
+// mergeSortedEntries merges two sorted slices of sparse entries, keeping
+// only the entry with the largest count for each repeated index.
+func mergeSortedEntries(a, b []uint32) []uint32 {
+	merged := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch ai, bj := sparseIndex(a[i]), sparseIndex(b[j]); {
+		case ai < bj:
+			merged = append(merged, a[i])
+			i++
+		case ai > bj:
+			merged = append(merged, b[j])
+			j++
+		default:
+			if a[i] > b[j] {
+				merged = append(merged, a[i])
+			} else {
+				merged = append(merged, b[j])
+			}
+			i++
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	merged = append(merged, b[j:]...)
+	return dedupeEntries(merged)
+}
+
+// dedupeEntries collapses runs of entries sharing an index, keeping the
+// one with the largest count. entries must already be sorted.
+func dedupeEntries(entries []uint32) []uint32 {
+	if len(entries) == 0 {
+		return entries
+	}
+	out := entries[:1]
+	for _, e := range entries[1:] {
+		last := out[len(out)-1]
+		if sparseIndex(e) == sparseIndex(last) {
+			if e > last {
+				out[len(out)-1] = e
+			}
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// encodeSparseList delta+varint encodes a sorted slice of sparse entries.
+func encodeSparseList(entries []uint32) []byte {
+	buf := make([]byte, 0, len(entries)*2)
+	tmp := make([]byte, binary.MaxVarintLen32)
+	var prev uint32
+	for _, e := range entries {
+		n := binary.PutUvarint(tmp, uint64(e-prev))
+		buf = append(buf, tmp[:n]...)
+		prev = e
+	}
+	return buf
+}
+
+// decodeSparseList reverses encodeSparseList.
+func decodeSparseList(b []byte) []uint32 {
+	if len(b) == 0 {
+		return nil
+	}
+	entries := make([]uint32, 0, len(b)/2)
+	var prev uint32
+	for len(b) > 0 {
+		d, n := binary.Uvarint(b)
+		b = b[n:]
+		prev += uint32(d)
+		entries = append(entries, prev)
+	}
+	return entries
+}
+
+// addSparse records item's hash in the tmp set, flushing it into the
+// sorted sparse list once it grows large enough to amortize the cost of
+// the merge.
+func (h *HyperLogLog) addSparse(x uint32) {
+	h.tmpSet = append(h.tmpSet, encodeHash(x))
+	if uint32(len(h.tmpSet)) > h.m/4 {
+		h.mergeSparse()
+	}
+}
+
+// mergeSparse folds the tmp set into the sorted sparse list and promotes
+// h to a dense representation if the encoded list has grown as large as
+// the dense array it stands in for.
+func (h *HyperLogLog) mergeSparse() {
+	if len(h.tmpSet) == 0 {
+		return
+	}
+	sort.Slice(h.tmpSet, func(i, j int) bool { return h.tmpSet[i] < h.tmpSet[j] })
+	merged := mergeSortedEntries(decodeSparseList(h.sparseList), h.tmpSet)
+	h.sparseList = encodeSparseList(merged)
+	h.tmpSet = h.tmpSet[:0]
+
+	if uint32(len(h.sparseList)) >= h.m {
+		h.densify()
+	}
+}
+
+// sparseEntries returns the full, merged set of entries currently held by
+// h without mutating it.
+func (h *HyperLogLog) sparseEntries() []uint32 {
+	if len(h.tmpSet) == 0 {
+		return decodeSparseList(h.sparseList)
+	}
+	tmp := append([]uint32(nil), h.tmpSet...)
+	sort.Slice(tmp, func(i, j int) bool { return tmp[i] < tmp[j] })
+	return mergeSortedEntries(decodeSparseList(h.sparseList), tmp)
+}
+
+// encodeSparsePayload serializes the tmp set and sparse list into a single
+// byte slice for use by MarshalBinary: a varint count of tmp entries, the
+// varint-encoded tmp entries themselves, then the sparse list as-is.
+func encodeSparsePayload(tmpSet []uint32, sparseList []byte) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, uint64(len(tmpSet)))
+	buf := append([]byte(nil), tmp[:n]...)
+	for _, e := range tmpSet {
+		n := binary.PutUvarint(tmp, uint64(e))
+		buf = append(buf, tmp[:n]...)
+	}
+	buf = append(buf, sparseList...)
+	return buf
+}
+
+// decodeSparsePayload reverses encodeSparsePayload.
+func decodeSparsePayload(b []byte) (tmpSet []uint32, sparseList []byte, err error) {
+	count, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, nil, errors.New("hyperloglog: corrupt sparse payload")
+	}
+	b = b[n:]
+	tmpSet = make([]uint32, 0, count)
+	for i := uint64(0); i < count; i++ {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, nil, errors.New("hyperloglog: corrupt sparse payload")
+		}
+		tmpSet = append(tmpSet, uint32(v))
+		b = b[n:]
+	}
+	sparseList = append([]byte(nil), b...)
+	return tmpSet, sparseList, nil
+}
+
+// densify materializes a dense register array from the sparse
+// representation and switches h over to it.
+func (h *HyperLogLog) densify() {
+	reg := make([]uint8, h.m)
+	for _, e := range h.sparseEntries() {
+		idx, count := projectEntry(e, h.p)
+		if count > reg[idx] {
+			reg[idx] = count
+		}
+	}
+	h.reg = reg
+	h.sparse = false
+	h.tmpSet = nil
+	h.sparseList = nil
+}